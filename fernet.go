@@ -20,6 +20,7 @@ import (
 	"crypto/subtle"
 	"encoding/base64"
 	"encoding/binary"
+	"errors"
 	"io"
 	"io/ioutil"
 	"time"
@@ -139,66 +140,231 @@ func genhmac(q, p, k []byte) {
 	h.Sum(q)
 }
 
-type reader struct {
-	plain *bytes.Buffer
-	ttl   time.Duration
-	keys  []*Key
-	r     io.Reader
-	err   error
+// DefaultChunkSize is the ChunkSize a Writer or Reader uses unless
+// told otherwise: the plaintext of a stream is split into Fernet
+// tokens of at most this many bytes each.
+const DefaultChunkSize = 64 * 1024
+
+// Layout of the plaintext prefix placed in front of each chunk's
+// payload before it is sealed as a Fernet token: a sequence number,
+// used to detect reordering or replay, and a flags byte, whose only
+// defined bit marks the final chunk of a stream so truncation can be
+// detected.
+const (
+	chunkSeqLen = 4
+	chunkHdrLen = chunkSeqLen + 1
+	chunkFinal  = 1 << 0
+)
+
+var errInvalidToken = errors.New("fernet: invalid token")
+var errChunkOrder = errors.New("fernet: chunks out of order")
+var errChunkTooLarge = errors.New("fernet: chunk length prefix exceeds ChunkSize")
+
+// A Reader decrypts and verifies a stream produced by a Writer,
+// reading only as much ciphertext as it needs to satisfy each Read,
+// so memory use stays bounded regardless of stream length.
+//
+// ChunkSize controls how the underlying stream is framed, not how
+// much is read at once: a nonzero ChunkSize (the default, set by
+// NewReader) expects the length-prefixed sequence of chunk tokens
+// written by a Writer with a nonzero ChunkSize. ChunkSize == 0 reads
+// the legacy format of a single Fernet token spanning the entire
+// stream, as produced by a Writer with ChunkSize == 0, and as
+// VerifyAndDecrypt expects.
+type Reader struct {
+	Keys      []*Key
+	TTL       time.Duration
+	ChunkSize int
+
+	r       io.Reader
+	plain   *bytes.Buffer
+	err     error
+	nextSeq uint32
+	done    bool
 }
 
-func (r *reader) Read(p []byte) (n int, err error) {
+func (r *Reader) Read(p []byte) (n int, err error) {
 	if r.err != nil {
 		return 0, r.err
 	}
+	if r.ChunkSize == 0 {
+		return r.readSingle(p)
+	}
+	for r.plain == nil || r.plain.Len() == 0 {
+		if r.done {
+			r.err = io.EOF
+			return 0, r.err
+		}
+		if err := r.readChunk(); err != nil {
+			r.err = err
+			return 0, r.err
+		}
+	}
+	return r.plain.Read(p)
+}
 
+// readSingle implements the legacy single-token wire format: the
+// whole stream is one Fernet token that can't be read until it has
+// all arrived.
+func (r *Reader) readSingle(p []byte) (int, error) {
 	if r.plain == nil {
 		cypher, err := ioutil.ReadAll(r.r)
 		if err != nil {
 			r.err = err
 			return 0, r.err
 		}
-		for _, k := range r.keys {
-			msg := verify(nil, cypher, r.ttl, time.Now(), k)
-			if msg != nil {
-				r.plain = bytes.NewBuffer(msg)
-				break
-			}
+		msg := r.verify(cypher)
+		if msg == nil {
+			r.err = errInvalidToken
+			return 0, r.err
 		}
+		r.plain = bytes.NewBuffer(msg)
 	}
-
 	return r.plain.Read(p)
 }
 
-func (r *reader) Reset(nr io.Reader) {
-	r.plain = nil
-	r.r = nr
+// maxChunkTokenLen returns the longest base64 chunk token readChunk
+// will accept for the given ChunkSize: the encoded length of sealing
+// a full chunk's header plus payload. A length prefix claiming more
+// than this is rejected before any allocation is made for it, so a
+// forged prefix can't force an unbounded allocation.
+func maxChunkTokenLen(chunkSize int) int {
+	return encoding.EncodedLen(encodedLen(chunkHdrLen + chunkSize))
+}
+
+// readChunk reads and verifies the next length-prefixed chunk token
+// from r.r and makes its payload available from r.plain.
+func (r *Reader) readChunk() error {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r.r, lenBuf[:]); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	n := binary.BigEndian.Uint32(lenBuf[:])
+	if n == 0 || n > uint32(maxChunkTokenLen(r.ChunkSize)) {
+		return errChunkTooLarge
+	}
+	tokb64 := make([]byte, n)
+	if _, err := io.ReadFull(r.r, tokb64); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	tok := b64dec(tokb64)
+	if tok == nil {
+		return errInvalidToken
+	}
+	msg := r.verify(tok)
+	if msg == nil || len(msg) < chunkHdrLen {
+		return errInvalidToken
+	}
+	if seq := binary.BigEndian.Uint32(msg[:chunkSeqLen]); seq != r.nextSeq {
+		return errChunkOrder
+	}
+	r.nextSeq++
+	if msg[chunkSeqLen]&chunkFinal != 0 {
+		r.done = true
+	}
+	r.plain = bytes.NewBuffer(msg[chunkHdrLen:])
+	return nil
+}
+
+// verify tries tok, a decoded (non-base64) token, against every key
+// in r.Keys in order and returns the first decrypted message, or nil
+// if none verifies. It dispatches on tok's leading version byte, so
+// it transparently accepts a token from any registered Suite.
+func (r *Reader) verify(tok []byte) []byte {
+	now := time.Now()
+	for _, k := range r.Keys {
+		if msg := openWithSuite(tok, r.TTL, now, k); msg != nil {
+			return msg
+		}
+	}
+	return nil
+}
+
+func (r *Reader) Reset(nr io.Reader) {
+	*r = Reader{Keys: r.Keys, TTL: r.TTL, ChunkSize: r.ChunkSize, r: nr}
 }
 
-func NewReader(keys []*Key, ttl time.Duration, r io.Reader) io.Reader {
-	return &reader{keys: keys, ttl: ttl, r: r}
+// NewReader returns a Reader that decrypts and verifies r using keys,
+// which are tried in order, rejecting tokens older than ttl. By
+// default it expects the chunked wire format written by a Writer with
+// a nonzero ChunkSize; set ChunkSize to 0 to read the legacy
+// single-token format instead.
+func NewReader(keys []*Key, ttl time.Duration, r io.Reader) *Reader {
+	return &Reader{Keys: keys, TTL: ttl, ChunkSize: DefaultChunkSize, r: r}
 }
 
-type writer struct {
-	key    *Key
+// A Writer seals its input into a sequence of length-prefixed Fernet
+// tokens ("chunks") bounded by ChunkSize, so Close does not have to
+// buffer the entire plaintext in memory and Write can make progress
+// on a long-lived stream as data arrives.
+//
+// ChunkSize defaults (via NewWriter) to DefaultChunkSize. Set it to 0
+// before the first Write to fall back to the legacy behavior of
+// earlier versions: Close seals the entire buffered plaintext as a
+// single Fernet token, as EncryptAndSign does.
+type Writer struct {
+	Key       *Key
+	ChunkSize int
+
 	w      io.WriteCloser
 	buf    *bytes.Buffer
 	err    error
-	iv     []byte
+	seq    uint32
 	closed bool
 }
 
-func (w *writer) Write(p []byte) (n int, err error) {
+func (w *Writer) Write(p []byte) (n int, err error) {
 	if w.err != nil {
 		return 0, w.err
 	}
 
-	return w.buf.Write(p)
+	n, err = w.buf.Write(p)
+	if err != nil {
+		return n, err
+	}
+	for w.ChunkSize > 0 && w.buf.Len() >= w.ChunkSize {
+		chunk := make([]byte, w.ChunkSize)
+		w.buf.Read(chunk)
+		if err := w.writeChunk(chunk, false); err != nil {
+			w.err = err
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// writeChunk seals payload, prefixed with its chunk header, as a
+// Fernet token and writes it to w.w as a 4-byte big-endian length
+// followed by the base64 token.
+func (w *Writer) writeChunk(payload []byte, final bool) error {
+	hdr := make([]byte, chunkHdrLen)
+	binary.BigEndian.PutUint32(hdr[:chunkSeqLen], w.seq)
+	if final {
+		hdr[chunkSeqLen] = chunkFinal
+	}
+	w.seq++
+
+	pt := append(hdr, payload...)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return err
+	}
+	tok := make([]byte, encodedLen(len(pt)))
+	n := gen(tok, pt, iv, time.Now(), w.Key)
+	tokb64 := b64enc(tok[:n])
+
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(tokb64)))
+	if _, err := w.w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	_, err := w.w.Write(tokb64)
+	return err
 }
 
 // Close closes the underlying Writer and returns its Close return value, if the Writer
 // is also an io.Closer. Otherwise it returns nil.
-func (w *writer) Close() error {
+func (w *Writer) Close() error {
 	if w.err != nil {
 		return w.err
 	}
@@ -208,27 +374,34 @@ func (w *writer) Close() error {
 	}
 	w.closed = true
 
-	// Initialize IV
-	iv := make([]byte, aes.BlockSize)
-	io.ReadFull(rand.Reader, iv)
+	if w.ChunkSize == 0 {
+		iv := make([]byte, aes.BlockSize)
+		io.ReadFull(rand.Reader, iv)
 
-	b := make([]byte, encodedLen(w.buf.Len()))
-	n := gen(b, w.buf.Bytes(), iv, time.Now(), w.key)
+		b := make([]byte, encodedLen(w.buf.Len()))
+		n := gen(b, w.buf.Bytes(), iv, time.Now(), w.Key)
 
-	if _, w.err = w.w.Write(b[:n]); w.err != nil {
-		return w.err
+		if _, w.err = w.w.Write(b[:n]); w.err != nil {
+			return w.err
+		}
+		return w.w.Close()
 	}
 
+	if w.err = w.writeChunk(w.buf.Bytes(), true); w.err != nil {
+		return w.err
+	}
 	return w.w.Close()
 }
 
-func (w *writer) Reset(nw io.WriteCloser) {
-	w.buf = &bytes.Buffer{}
-	w.w = nw
+func (w *Writer) Reset(nw io.WriteCloser) {
+	*w = Writer{Key: w.Key, ChunkSize: w.ChunkSize, w: nw, buf: &bytes.Buffer{}}
 }
 
-func NewWriter(key *Key, w io.WriteCloser) io.WriteCloser {
-	return &writer{key: key, w: w, buf: &bytes.Buffer{}}
+// NewWriter returns a Writer that seals writes to it with key and
+// writes the result to w. ChunkSize defaults to DefaultChunkSize; set
+// it to 0 for the legacy single-token behavior.
+func NewWriter(key *Key, w io.WriteCloser) *Writer {
+	return &Writer{Key: key, w: w, buf: &bytes.Buffer{}, ChunkSize: DefaultChunkSize}
 }
 
 // Encrypts and signs msg with key k and returns the resulting
@@ -237,6 +410,7 @@ func NewWriter(key *Key, w io.WriteCloser) io.WriteCloser {
 func EncryptAndSign(msg []byte, k *Key) (tok []byte, err error) {
 	buf := &bytes.Buffer{}
 	w := NewWriter(k, base64.NewEncoder(encoding, buf))
+	w.ChunkSize = 0
 	r := bytes.NewReader(msg)
 	if _, err := io.Copy(w, r); err != nil {
 		return nil, err
@@ -250,6 +424,7 @@ func EncryptAndSign(msg []byte, k *Key) (tok []byte, err error) {
 // in tok if tok is valid, otherwise nil.
 func VerifyAndDecrypt(tok []byte, ttl time.Duration, k []*Key) (msg []byte) {
 	r := NewReader(k, ttl, base64.NewDecoder(encoding, bytes.NewReader(tok)))
+	r.ChunkSize = 0
 	msg, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil
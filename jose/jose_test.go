@@ -0,0 +1,49 @@
+package jose
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/fernet/fernet-go"
+)
+
+func TestEncryptDecryptJWE(t *testing.T) {
+	var k fernet.Key
+	for i := range k {
+		k[i] = byte(i)
+	}
+	msg := []byte("hello, jose")
+	tok, err := EncryptJWE(msg, &k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecryptJWE(tok, &k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Errorf("got %q, want %q", got, msg)
+	}
+}
+
+func TestDecryptJWEBadTag(t *testing.T) {
+	var k fernet.Key
+	tok, err := EncryptJWE([]byte("hi"), &k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(tok, ".")
+	tag, err := base64.RawURLEncoding.DecodeString(parts[4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag[0] ^= 0xff
+	parts[4] = base64.RawURLEncoding.EncodeToString(tag)
+	tok = strings.Join(parts, ".")
+
+	if _, err := DecryptJWE(tok, &k); err == nil {
+		t.Error("expected error for tampered tag")
+	}
+}
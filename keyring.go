@@ -0,0 +1,219 @@
+package fernet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+var errNoKeys = errors.New("fernet: key ring has no keys")
+
+// A KeyRing holds an ordered list of keys, most recent first, and
+// relieves the caller of managing key lifetime directly. Encrypt
+// always signs with the first key; Verify tries every key in order,
+// as VerifyAndDecrypt does for a []*Key.
+//
+// The zero KeyRing has no keys and is ready to use. A KeyRing must
+// not be copied after first use.
+type KeyRing struct {
+	// MaxAge is the maximum age a key may reach before Rotate
+	// retires it. A MaxAge of zero means keys are never retired
+	// by age.
+	MaxAge time.Duration
+
+	mu   sync.Mutex
+	keys []ringKey
+}
+
+type ringKey struct {
+	key       *Key
+	createdAt time.Time
+}
+
+// Add inserts k at the front of r as the current signing key.
+func (r *KeyRing) Add(k *Key) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.add(k, time.Now())
+}
+
+func (r *KeyRing) add(k *Key, createdAt time.Time) {
+	r.keys = append([]ringKey{{key: k, createdAt: createdAt}}, r.keys...)
+}
+
+// Keys returns the keys in r, most recent first.
+func (r *KeyRing) Keys() []*Key {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ks := make([]*Key, len(r.keys))
+	for i, rk := range r.keys {
+		ks[i] = rk.key
+	}
+	return ks
+}
+
+// Rotate generates a fresh key, promotes it to the front of r for
+// signing, and retires any key older than r.MaxAge. It returns the
+// new key.
+func (r *KeyRing) Rotate() (*Key, error) {
+	k := new(Key)
+	if err := k.Generate(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.add(k, now)
+	if r.MaxAge > 0 {
+		kept := r.keys[:0]
+		for _, rk := range r.keys {
+			if now.Sub(rk.createdAt) <= r.MaxAge {
+				kept = append(kept, rk)
+			}
+		}
+		r.keys = kept
+	}
+	return k, nil
+}
+
+// Encrypt encrypts and signs msg with the first key in r, as
+// EncryptAndSign does with a single key.
+func (r *KeyRing) Encrypt(msg []byte) (tok []byte, err error) {
+	return r.EncryptWith(msg, SuiteAESCBCHMAC{})
+}
+
+// EncryptWith is like Encrypt, but seals msg with suite instead of
+// SuiteAESCBCHMAC, as EncryptAndSignWith does with a single key.
+func (r *KeyRing) EncryptWith(msg []byte, suite Suite) (tok []byte, err error) {
+	r.mu.Lock()
+	if len(r.keys) == 0 {
+		r.mu.Unlock()
+		return nil, errNoKeys
+	}
+	k := r.keys[0].key
+	r.mu.Unlock()
+	return EncryptAndSignWith(msg, k, suite)
+}
+
+// Verify tries every key in r in order, as VerifyAndDecrypt does for
+// a []*Key, and returns the decrypted message from the first key
+// that verifies tok. As VerifyAndDecrypt does, it dispatches on tok's
+// leading version byte, so it transparently accepts a token from any
+// registered Suite. stale reports whether a key other than the
+// current front key (the one Encrypt would use) performed the
+// verification, so callers can be notified that an old key is still
+// in use.
+func (r *KeyRing) Verify(tok []byte, ttl time.Duration) (msg []byte, stale bool) {
+	raw := b64dec(tok)
+	if raw == nil {
+		return nil, false
+	}
+
+	r.mu.Lock()
+	keys := make([]*Key, len(r.keys))
+	for i, rk := range r.keys {
+		keys[i] = rk.key
+	}
+	r.mu.Unlock()
+
+	now := time.Now()
+	for i, k := range keys {
+		if msg = openWithSuite(raw, ttl, now, k); msg != nil {
+			return msg, i != 0
+		}
+	}
+	return nil, false
+}
+
+// fileKey is the JSON representation of a single key in a key ring
+// file, as read and written by LoadFile and SaveFile.
+type fileKey struct {
+	Key       string    `json:"key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoadFile reads a JSON-encoded key ring previously written by
+// SaveFile from path.
+func LoadFile(path string) (*KeyRing, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseKeyRing(b)
+}
+
+func parseKeyRing(b []byte) (*KeyRing, error) {
+	var fks []fileKey
+	if err := json.Unmarshal(b, &fks); err != nil {
+		return nil, err
+	}
+	r := new(KeyRing)
+	for _, fk := range fks {
+		k, err := DecodeKey(fk.Key)
+		if err != nil {
+			return nil, err
+		}
+		r.add(k, fk.CreatedAt)
+	}
+	return r, nil
+}
+
+// SaveFile writes r to path as JSON, most recent key first, with
+// each key's creation time so a future LoadFile can apply MaxAge
+// correctly. It is not safe to call SaveFile concurrently with
+// Rotate or Add on the same KeyRing.
+func (r *KeyRing) SaveFile(path string) error {
+	r.mu.Lock()
+	fks := make([]fileKey, len(r.keys))
+	for i, rk := range r.keys {
+		fks[i] = fileKey{Key: rk.key.Encode(), CreatedAt: rk.createdAt}
+	}
+	r.mu.Unlock()
+
+	b, err := json.Marshal(fks)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
+
+// Watch polls path at the given interval and, whenever its modtime
+// changes, reloads it and replaces r's keys with its contents so
+// that an operator rotating keys out-of-band (by writing a new file)
+// takes effect without a process restart. Watch runs until ctx is
+// done, and a file that fails to load is skipped, leaving r's
+// current keys in place, so a transient write does not clear them.
+func (r *KeyRing) Watch(ctx context.Context, path string, interval time.Duration) error {
+	var lastMod time.Time
+	if fi, err := os.Stat(path); err == nil {
+		lastMod = fi.ModTime()
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			fi, err := os.Stat(path)
+			if err != nil || !fi.ModTime().After(lastMod) {
+				continue
+			}
+			nr, err := LoadFile(path)
+			if err != nil {
+				continue
+			}
+			lastMod = fi.ModTime()
+
+			r.mu.Lock()
+			r.keys = nr.keys
+			r.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package fernet
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeyRingEncryptVerify(t *testing.T) {
+	r := new(KeyRing)
+	if _, err := r.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := r.Encrypt([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, stale := r.Verify(tok, 60*time.Second)
+	if string(msg) != "hello" {
+		t.Errorf("got %q", msg)
+	}
+	if stale {
+		t.Error("want fresh, got stale")
+	}
+
+	if _, err := r.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	msg, stale = r.Verify(tok, 60*time.Second)
+	if string(msg) != "hello" {
+		t.Errorf("got %q", msg)
+	}
+	if !stale {
+		t.Error("want stale after rotation")
+	}
+}
+
+func TestKeyRingEncryptWithSuite(t *testing.T) {
+	r := new(KeyRing)
+	if _, err := r.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := r.EncryptWith([]byte("hello"), SuiteAESCBCHMAC{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, stale := r.Verify(tok, 60*time.Second)
+	if string(msg) != "hello" {
+		t.Errorf("got %q", msg)
+	}
+	if stale {
+		t.Error("want fresh, got stale")
+	}
+}
+
+func TestKeyRingEncryptWithSuiteXChaCha20Poly1305(t *testing.T) {
+	r := new(KeyRing)
+	if _, err := r.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := r.EncryptWith([]byte("hello"), SuiteXChaCha20Poly1305{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, stale := r.Verify(tok, 60*time.Second)
+	if string(msg) != "hello" {
+		t.Errorf("got %q", msg)
+	}
+	if stale {
+		t.Error("want fresh, got stale")
+	}
+}
+
+func TestKeyRingRotateMaxAge(t *testing.T) {
+	r := new(KeyRing)
+	r.MaxAge = 0
+	k1, _ := r.Rotate()
+	r.mu.Lock()
+	r.keys[0].createdAt = time.Now().Add(-time.Hour)
+	r.mu.Unlock()
+	r.MaxAge = time.Minute
+	k2, _ := r.Rotate()
+
+	keys := r.Keys()
+	if len(keys) != 1 || keys[0] != k2 {
+		t.Errorf("want only %v retained, got %v", k2, keys)
+	}
+	_ = k1
+}
+
+func TestKeyRingSaveLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keys.json")
+
+	r := new(KeyRing)
+	r.Rotate()
+	r.Rotate()
+	if err := r.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Keys()) != 2 {
+		t.Errorf("want 2 keys, got %d", len(loaded.Keys()))
+	}
+}
+
+func TestKeyRingWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keys.json")
+
+	initial := new(KeyRing)
+	initial.Rotate()
+	if err := initial.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, path, 10*time.Millisecond)
+
+	time.Sleep(20 * time.Millisecond)
+
+	updated := new(KeyRing)
+	updated.Rotate()
+	updated.Rotate()
+	time.Sleep(20 * time.Millisecond) // ensure a distinct mtime
+	if err := updated.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(r.Keys()) != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(r.Keys()) != 2 {
+		t.Errorf("want 2 keys after watch reload, got %d", len(r.Keys()))
+	}
+}
@@ -0,0 +1,90 @@
+package fernet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func TestStreamRoundTrip(t *testing.T) {
+	var k Key
+	k.Generate()
+
+	msg := bytes.Repeat([]byte("hello world "), 10000) // > one default chunk
+
+	buf := &bytes.Buffer{}
+	w := NewWriter(&k, nopCloser{buf})
+	w.ChunkSize = 16
+	if _, err := w.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReader([]*Key{&k}, 60*time.Second, buf)
+	r.ChunkSize = 16
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Errorf("roundtrip mismatch, got %d bytes want %d", len(got), len(msg))
+	}
+}
+
+func TestStreamTruncationDetected(t *testing.T) {
+	var k Key
+	k.Generate()
+
+	buf := &bytes.Buffer{}
+	w := NewWriter(&k, nopCloser{buf})
+	w.ChunkSize = 16
+	w.Write(bytes.Repeat([]byte("x"), 100))
+	w.Close()
+
+	truncated := bytes.NewReader(buf.Bytes()[:buf.Len()-5])
+	r := NewReader([]*Key{&k}, 60*time.Second, truncated)
+	r.ChunkSize = 16
+	if _, err := ioutil.ReadAll(r); err == nil {
+		t.Error("expected error on truncated stream")
+	}
+}
+
+func TestStreamRejectsOversizedLengthPrefix(t *testing.T) {
+	var k Key
+	k.Generate()
+
+	var forged bytes.Buffer
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], 0xffffffff) // ~4 GiB claimed chunk
+	forged.Write(lenBuf[:])
+
+	r := NewReader([]*Key{&k}, 60*time.Second, &forged)
+	r.ChunkSize = 16
+	if _, err := ioutil.ReadAll(r); err != errChunkTooLarge {
+		t.Errorf("got err %v, want errChunkTooLarge", err)
+	}
+}
+
+func TestStreamLegacySingleToken(t *testing.T) {
+	var k Key
+	k.Generate()
+	msg := []byte("small message")
+
+	tok, err := EncryptAndSign(msg, &k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := VerifyAndDecrypt(tok, 60*time.Second, []*Key{&k})
+	if !bytes.Equal(got, msg) {
+		t.Errorf("got %q want %q", got, msg)
+	}
+}
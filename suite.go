@@ -0,0 +1,135 @@
+package fernet
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// version2 is the leading byte of a token sealed with
+// SuiteXChaCha20Poly1305.
+const version2 byte = 0x81
+
+// nonceSize2 is the length of the random nonce SuiteXChaCha20Poly1305
+// places in a token, and hdrLen2 the length of everything in the
+// token that precedes its ciphertext: the version byte, the 8-byte
+// issued-at timestamp, and the nonce.
+const (
+	nonceSize2 = chacha20poly1305.NonceSizeX
+	hdrLen2    = 1 + 8 + nonceSize2
+)
+
+// A Suite implements one version of the Fernet wire format, selected
+// by its leading version byte. gen and verify's AES-CBC-HMAC
+// construction is exposed as SuiteAESCBCHMAC so it can be selected
+// explicitly; SuiteXChaCha20Poly1305 implements a second version that
+// uses a combined AEAD instead of a separate cipher and HMAC pass.
+type Suite interface {
+	version() byte
+	seal(msg []byte, ts time.Time, k *Key) []byte
+	open(tok []byte, ttl time.Duration, now time.Time, k *Key) []byte
+}
+
+// suites maps each known version byte to the Suite that reads and
+// writes it, so verify can dispatch on a token's leading byte without
+// the caller naming a Suite.
+var suites = map[byte]Suite{
+	version:  SuiteAESCBCHMAC{},
+	version2: SuiteXChaCha20Poly1305{},
+}
+
+// SuiteAESCBCHMAC is the original Fernet wire format: AES-128-CBC
+// encryption with a separate HMAC-SHA256 pass, version byte 0x80.
+type SuiteAESCBCHMAC struct{}
+
+func (SuiteAESCBCHMAC) version() byte { return version }
+
+func (SuiteAESCBCHMAC) seal(msg []byte, ts time.Time, k *Key) []byte {
+	iv := make([]byte, aes.BlockSize)
+	io.ReadFull(rand.Reader, iv)
+	tok := make([]byte, encodedLen(len(msg)))
+	n := gen(tok, msg, iv, ts, k)
+	return tok[:n]
+}
+
+func (SuiteAESCBCHMAC) open(tok []byte, ttl time.Duration, now time.Time, k *Key) []byte {
+	return verify(nil, tok, ttl, now, k)
+}
+
+// SuiteXChaCha20Poly1305 is a Fernet wire format using
+// XChaCha20-Poly1305, version byte 0x81. In place of AES-CBC padding
+// plus a separate HMAC, a single AEAD operation provides both
+// confidentiality and integrity over the message, authenticating the
+// version byte and issued-at timestamp as associated data.
+type SuiteXChaCha20Poly1305 struct{}
+
+func (SuiteXChaCha20Poly1305) version() byte { return version2 }
+
+func (SuiteXChaCha20Poly1305) seal(msg []byte, ts time.Time, k *Key) []byte {
+	aead, err := chacha20poly1305.NewX(k[:])
+	if err != nil {
+		// k is always chacha20poly1305.KeySize bytes, so NewX cannot
+		// fail.
+		panic(err)
+	}
+
+	hdr := make([]byte, hdrLen2)
+	hdr[0] = version2
+	binary.BigEndian.PutUint64(hdr[1:9], uint64(ts.Unix()))
+	nonce := hdr[9:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		// A failed nonce read must not fall through to a zero nonce:
+		// unlike IV reuse under CBC, nonce reuse under a combined AEAD
+		// breaks both confidentiality and integrity.
+		panic(err)
+	}
+
+	return aead.Seal(hdr, nonce, msg, hdr[:9])
+}
+
+func (SuiteXChaCha20Poly1305) open(tok []byte, ttl time.Duration, now time.Time, k *Key) []byte {
+	if len(tok) < hdrLen2 {
+		return nil
+	}
+	ts := time.Unix(int64(binary.BigEndian.Uint64(tok[1:9])), 0)
+	if now.After(ts.Add(ttl)) || ts.After(now.Add(maxClockSkew)) {
+		return nil
+	}
+
+	aead, err := chacha20poly1305.NewX(k[:])
+	if err != nil {
+		return nil
+	}
+	nonce := tok[9:hdrLen2]
+	msg, err := aead.Open(nil, nonce, tok[hdrLen2:], tok[:9])
+	if err != nil {
+		return nil
+	}
+	return msg
+}
+
+// openWithSuite verifies tok, a decoded (non-base64) token, against k
+// using whichever Suite tok's leading version byte selects. It
+// returns nil if the version byte is unrecognized or tok fails to
+// verify.
+func openWithSuite(tok []byte, ttl time.Duration, now time.Time, k *Key) []byte {
+	if len(tok) < 1 {
+		return nil
+	}
+	suite, ok := suites[tok[0]]
+	if !ok {
+		return nil
+	}
+	return suite.open(tok, ttl, now, k)
+}
+
+// EncryptAndSignWith encrypts and signs msg with k using suite and
+// returns the resulting token. EncryptAndSign is equivalent to
+// EncryptAndSignWith(msg, k, SuiteAESCBCHMAC{}).
+func EncryptAndSignWith(msg []byte, k *Key, suite Suite) (tok []byte, err error) {
+	return b64enc(suite.seal(msg, time.Now(), k)), nil
+}
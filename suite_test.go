@@ -0,0 +1,51 @@
+package fernet
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSuiteXChaCha20Poly1305RoundTrip(t *testing.T) {
+	var k Key
+	k.Generate()
+	msg := []byte("hello suite")
+
+	tok, err := EncryptAndSignWith(msg, &k, SuiteXChaCha20Poly1305{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := VerifyAndDecrypt(tok, 60*time.Second, []*Key{&k})
+	if !bytes.Equal(got, msg) {
+		t.Errorf("got %q want %q", got, msg)
+	}
+}
+
+func TestSuiteAESCBCHMACExplicit(t *testing.T) {
+	var k Key
+	k.Generate()
+	msg := []byte("hello legacy suite")
+
+	tok, err := EncryptAndSignWith(msg, &k, SuiteAESCBCHMAC{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := VerifyAndDecrypt(tok, 60*time.Second, []*Key{&k})
+	if !bytes.Equal(got, msg) {
+		t.Errorf("got %q want %q", got, msg)
+	}
+}
+
+func TestVerifyAndDecryptRejectsUnknownVersion(t *testing.T) {
+	var k Key
+	k.Generate()
+	tok, _ := EncryptAndSignWith([]byte("hi"), &k, SuiteAESCBCHMAC{})
+
+	raw := b64dec(tok)
+	raw[0] = 0xff
+	tampered := b64enc(raw)
+
+	if got := VerifyAndDecrypt(tampered, 60*time.Second, []*Key{&k}); got != nil {
+		t.Errorf("got %q, want nil", got)
+	}
+}